@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+//checkpointState is what -checkpoint persists so a killed export can resume
+//instead of restarting from zero.
+type checkpointState struct {
+	ScrollID       string        `json:"scroll_id"`
+	PitID          string        `json:"pit_id"`
+	TotalLines     uint64        `json:"total_lines"`
+	LastSortValues []interface{} `json:"last_sort_values"`
+	QueryHash      string        `json:"query_hash"`
+	Index          string        `json:"index"`
+	StartedAt      time.Time     `json:"started_at"`
+}
+
+//queryHash fingerprints the index set and query body, so a checkpoint is
+//only resumed if it matches the query it was written for.
+func (t *App) queryHash() string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join(t.opts.index, ",")))
+	h.Write([]byte(t.opts.q))
+	if t.opts.queryBody != nil {
+		h.Write(t.opts.queryBody.Bytes())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//saveCheckpoint persists the resume state for the page just processed.
+func (t *App) saveCheckpoint(r *result) {
+	cp := checkpointState{
+		ScrollID:   r.ScrollID,
+		PitID:      r.PitID,
+		TotalLines: totalLines,
+		QueryHash:  t.queryHash(),
+		Index:      strings.Join(t.opts.index, ","),
+		StartedAt:  t.checkpointAt,
+	}
+	if n := len(r.Hits.Hits); n > 0 {
+		cp.LastSortValues = r.Hits.Hits[n-1].Sort
+	}
+
+	if err := writeCheckpointState(t.opts.checkpointFile, &cp); err != nil {
+		log.Printf("Error writing checkpoint: %s", err)
+	}
+}
+
+//writeCheckpointState persists cp to path atomically, via a temp file and rename.
+func writeCheckpointState(path string, cp *checkpointState) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadCheckpointState(path string) (*checkpointState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp checkpointState
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+//resumeFromCheckpoint loads -checkpoint and, if it matches the current
+//query and index, continues the scroll it describes. A PIT checkpoint, or
+//a scroll whose context has expired, is resumed by opening a fresh
+//Point-in-Time and searching after the stored sort values; the stored pit
+//id is not reused. It reports whether it actually resumed; the caller falls
+//back to a fresh run otherwise.
+func (t *App) resumeFromCheckpoint() bool {
+	cp, err := loadCheckpointState(t.opts.checkpointFile)
+	if err != nil {
+		log.Printf("No checkpoint to resume from: %s", err)
+		return false
+	}
+	if cp.QueryHash != t.queryHash() || cp.Index != strings.Join(t.opts.index, ",") {
+		log.Printf("Checkpoint does not match the current query, starting over")
+		return false
+	}
+
+	totalLines = cp.TotalLines
+	t.checkpointAt = cp.StartedAt
+	log.Printf("Resuming from checkpoint at %d lines", cp.TotalLines)
+
+	if cp.PitID != "" {
+		t.replayPIT(cp.LastSortValues)
+		return true
+	}
+
+	if t.resumeScroll(cp.ScrollID) {
+		return true
+	}
+
+	log.Printf("Scroll checkpoint has expired, replaying via Point-in-Time instead")
+	t.replayPIT(cp.LastSortValues)
+	return true
+}
+
+//resumeScroll continues an existing scroll context. Unlike scroll(), it
+//reports failure instead of fataling, so the caller can fall back to PIT.
+func (t *App) resumeScroll(scrollID string) bool {
+	res, err := t.esClient.Scroll(
+		t.esClient.Scroll.WithContext(context.Background()),
+		t.esClient.Scroll.WithScrollID(scrollID),
+		t.esClient.Scroll.WithScroll(t.opts.scroll),
+	)
+	if err != nil || res.IsError() {
+		return false
+	}
+	defer res.Body.Close()
+
+	t.paginator = &ScrollPaginator{}
+	t.parseResult(res)
+	return true
+}
+
+//replayPIT opens a fresh Point-in-Time and resumes with search_after set to
+//the last sort values the checkpoint recorded.
+func (t *App) replayPIT(lastSortValues []interface{}) {
+	p := &PITPaginator{}
+	t.paginator = p
+
+	res, err := t.esClient.OpenPointInTime(
+		t.opts.index,
+		t.opts.scroll.String(),
+		t.esClient.OpenPointInTime.WithContext(context.Background()),
+	)
+	if err != nil {
+		log.Fatalf("Error opening point in time: %s", err)
+	}
+	defer res.Body.Close()
+
+	var o struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&o); err != nil {
+		log.Fatalf("Error parsing the response body: %s", err)
+	}
+	p.pitID = o.ID
+
+	sRes, err := t.esClient.Search(
+		t.esClient.Search.WithContext(context.Background()),
+		t.esClient.Search.WithBody(p.body(t, lastSortValues)),
+	)
+	if err != nil {
+		log.Fatalf("Error getting search response: %s", err)
+	}
+	defer sRes.Body.Close()
+
+	t.parseResult(sRes)
+}
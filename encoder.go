@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Encoder writes a batch of hits to the configured output in a particular
+//format. NDJSON is the default; -format selects csv, parquet or bulk.
+type Encoder interface {
+	Write(hits []hit)
+	Close()
+}
+
+//newEncoder picks the Encoder for t.opts.format.
+func (t *App) newEncoder() Encoder {
+	switch t.opts.format {
+	case "ndjson":
+		return &ndjsonEncoder{out: t.opts.output, pool: t.pool}
+	case "csv":
+		requireExplicitFields(t.opts.format, t.opts.fields)
+		return newCSVEncoder(t.opts.output, t.opts.fields)
+	case "bulk":
+		return &bulkEncoder{out: t.opts.output, pool: t.pool, index: t.opts.bulkIndex}
+	case "parquet":
+		if t.opts.print {
+			log.Fatalf("-p is not supported together with -format parquet: parquet is a binary container format written directly to -o, it can't stream to stdout")
+		}
+		requireExplicitFields(t.opts.format, t.opts.fields)
+		return newParquetEncoder(t.opts.outputFile, t.opts.fields)
+	default:
+		log.Fatalf("Unknown -format %q: expected one of ndjson, csv, parquet, bulk", t.opts.format)
+		return nil
+	}
+}
+
+//requireExplicitFields fatals if fields is still the "*" default: csv and
+//parquet need concrete field names to build their header/schema from, and
+//silently writing a single useless "*" column is worse than refusing to run.
+func requireExplicitFields(format string, fields []string) {
+	if len(fields) == 1 && fields[0] == "*" {
+		log.Fatalf("-format %s requires an explicit -f field list (the default '*' can't be turned into columns)", format)
+	}
+}
+
+//ndjsonEncoder writes one JSON-encoded _source per line. This is the
+//original, default behavior.
+type ndjsonEncoder struct {
+	out  io.Writer
+	pool *sync.Pool
+}
+
+func (e *ndjsonEncoder) Write(hits []hit) {
+	buf := e.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer e.pool.Put(buf)
+
+	for _, v := range hits {
+		j, _ := json.Marshal(v.Source)
+		buf.Write(j)
+		buf.WriteByte('\n')
+	}
+
+	e.out.Write(buf.Bytes())
+}
+
+func (e *ndjsonEncoder) Close() {}
+
+//bulkEncoder wraps each hit as an `{"index":{...}}` action line followed by
+//the document, so the output can be fed straight back into _bulk to reindex
+//into another cluster.
+type bulkEncoder struct {
+	out   io.Writer
+	pool  *sync.Pool
+	index string
+}
+
+func (e *bulkEncoder) Write(hits []hit) {
+	buf := e.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer e.pool.Put(buf)
+
+	for _, v := range hits {
+		index := v.Index
+		if e.index != "" {
+			index = e.index
+		}
+
+		action, _ := json.Marshal(map[string]interface{}{
+			"index": map[string]string{"_index": index, "_id": v.ID},
+		})
+		doc, _ := json.Marshal(v.Source)
+
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(doc)
+		buf.WriteByte('\n')
+	}
+
+	e.out.Write(buf.Bytes())
+}
+
+func (e *bulkEncoder) Close() {}
+
+//csvEncoder flattens each hit's _source into the header's dotted field
+//paths and writes one CSV row per hit. The header row is written once, up
+//front, from the -f field list.
+type csvEncoder struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func newCSVEncoder(out io.Writer, fields []string) *csvEncoder {
+	e := &csvEncoder{w: csv.NewWriter(out), fields: fields}
+	e.w.Write(fields)
+	e.w.Flush()
+	return e
+}
+
+func (e *csvEncoder) Write(hits []hit) {
+	for _, v := range hits {
+		flat := map[string]string{}
+		flattenJSON("", v.Source, flat)
+
+		row := make([]string, len(e.fields))
+		for i, f := range e.fields {
+			row[i] = flat[f]
+		}
+		e.w.Write(row)
+	}
+	e.w.Flush()
+}
+
+func (e *csvEncoder) Close() {}
+
+//flattenJSON walks an arbitrarily nested JSON value, recording every leaf
+//under its dotted path (e.g. "user.address.city") in out.
+func flattenJSON(prefix string, v interface{}, out map[string]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flattenJSON(joinPath(prefix, k), val[k], out)
+		}
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			flattenJSON(fmt.Sprintf("%s.%d", prefix, i), item, out)
+			parts[i] = fmt.Sprintf("%v", item)
+		}
+		//Also populate the bare key (e.g. "tags"), joined, since that's the
+		//header -f actually asks for; without it an array-typed field
+		//silently renders as an empty cell.
+		out[prefix] = strings.Join(parts, ";")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprintf("%v", val)
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return strings.Join([]string{prefix, key}, ".")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want map[string]string
+	}{
+		{
+			name: "flat object",
+			in:   map[string]interface{}{"status": "active", "count": float64(3)},
+			want: map[string]string{"status": "active", "count": "3"},
+		},
+		{
+			name: "nested object uses dotted paths",
+			in:   map[string]interface{}{"user": map[string]interface{}{"address": map[string]interface{}{"city": "NYC"}}},
+			want: map[string]string{"user.address.city": "NYC"},
+		},
+		{
+			name: "array populates both indexed and bare keys",
+			in:   map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			want: map[string]string{"tags.0": "a", "tags.1": "b", "tags": "a;b"},
+		},
+		{
+			name: "nil value is an empty cell",
+			in:   map[string]interface{}{"deleted_at": nil},
+			want: map[string]string{"deleted_at": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := map[string]string{}
+			flattenJSON("", tt.in, out)
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Fatalf("flattenJSON(%v) = %v, want %v", tt.in, out, tt.want)
+			}
+		})
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
-	"github.com/elastic/go-elasticsearch/v6"
-	"github.com/elastic/go-elasticsearch/v6/esapi"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/qichengzx/mes/query"
 	"io"
 	"log"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -34,8 +36,9 @@ type options struct {
 	//elasticsearch options
 	address []string
 	index   []string
+	//exclude drops any index matching these glob patterns, e.g. ".kibana*".
+	exclude []string
 	sort    []string
-	docType string
 
 	scroll time.Duration
 
@@ -43,13 +46,39 @@ type options struct {
 	size      int
 	maxResult int
 
+	//slices is the number of parallel scroll slices to export with. Default
+	//is 1, meaning no slicing.
+	slices int
+
 	fields   []string
 	q        string
 	rawQuery bool
+	//queryFile is a path to a YAML/JSON structured query config, an
+	//alternative to -q and -r.
+	queryFile string
 	//queryBody is elasticsearch query body
 	queryBody *bytes.Buffer
 	username  string
 	password  string
+
+	//pit switches pagination from scroll to the ES8 Point-in-Time API.
+	pit bool
+
+	//aggOutputFile is where aggregations from the query are written, since
+	//parseResult otherwise has nowhere to put them.
+	aggOutputFile string
+
+	//format is the output encoding: ndjson (default), csv, parquet or bulk.
+	format string
+	//bulkIndex overrides the target _index for -format bulk. Empty means
+	//keep each hit's source index, for a straight reindex.
+	bulkIndex string
+
+	//checkpointFile is where resume state is periodically persisted. Empty
+	//disables checkpointing.
+	checkpointFile string
+	//resume opts into continuing from checkpointFile instead of starting over.
+	resume bool
 }
 
 type App struct {
@@ -59,13 +88,18 @@ type App struct {
 	queryResult uint64
 	//numResult is actually result count to result.
 	numResult uint64
-	scrollIDs []string
 	sIDs      map[string]struct{}
 
 	pool  *sync.Pool
 	mutex sync.Mutex
 
-	esClient *elasticsearch.Client
+	esClient  *elasticsearch.Client
+	paginator Paginator
+	encoder   Encoder
+	progress  *progress
+
+	aggsWritten  bool
+	checkpointAt time.Time
 }
 
 func main() {
@@ -76,22 +110,35 @@ func main() {
 	}
 
 	var indexPrefix string
+	var exclude string
 	var fields string
 	flag.StringVar(&opts.q, "q", "", "Query string in Lucene syntax.")
 	flag.BoolVar(&opts.rawQuery, "r", false, "Switch query format in the Query DSL.")
+	flag.StringVar(&opts.queryFile, "query-file", "", "Path to a YAML/JSON structured query config. Overrides -q and -r.")
+	flag.StringVar(&opts.aggOutputFile, "agg-output", "./es.agg.export.log", "Path to write query aggregations to, if any.")
 	flag.StringVar(&u, "u", "http://localhost:9200", "Elasticsearch host URL. Default is \"http://localhost:9200\".")
 	flag.StringVar(&auth, "a", "", "Elasticsearch basic authentication in the form of username:password.")
 	flag.StringVar(&indexPrefix, "i", "", "Index name prefix(es). Split with ','. Default is _all.")
-	flag.StringVar(&opts.docType, "d", "_doc", "Document type(s).")
+	flag.StringVar(&exclude, "exclude", "", "Index name pattern(s) to exclude, e.g. '.kibana*'. Split with ','.")
 	flag.StringVar(&fields, "f", "", "List of selected fields in output.")
 	flag.BoolVar(&opts.print, "p", false, "Print to stdout. Default is false.")
 	flag.StringVar(&opts.outputFile, "o", "./es.export.log", "Path to export file. Default is ./es.export.log.")
 	flag.IntVar(&opts.maxResult, "m", 0, "Maximum number of results to return. Default is 0, No Limit.")
 	flag.IntVar(&opts.size, "s", 1000, "Scroll size for each batch of results. Default is 100.")
+	flag.IntVar(&opts.slices, "slices", 1, "Number of parallel scroll slices. Default is 1, no slicing.")
+	flag.BoolVar(&opts.pit, "pit", false, "Paginate with the Point-in-Time API instead of scroll. Default is false.")
+	flag.StringVar(&opts.format, "format", "ndjson", "Output format: ndjson, csv, parquet or bulk.")
+	flag.StringVar(&opts.bulkIndex, "bulk-index", "", "Target _index for -format bulk. Default is each hit's own _index.")
+	flag.StringVar(&opts.checkpointFile, "checkpoint", "", "Path to periodically persist resume state to. Default is disabled.")
+	flag.BoolVar(&opts.resume, "resume", false, "Resume from -checkpoint instead of starting over. Default is false.")
 	flag.Parse()
 
 	opts.output = os.Stdout
-	if !opts.print {
+	//-format parquet opens opts.outputFile itself (parquet needs a
+	//ReadWriteSeeker, not the plain io.Writer the other encoders use), so
+	//opening it here too would leave a second, unused handle on the same
+	//path for the whole run.
+	if !opts.print && opts.format != "parquet" {
 		fp, err := os.OpenFile(opts.outputFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0777)
 		if err != nil {
 			log.Fatalln(err)
@@ -125,6 +172,16 @@ func main() {
 		}
 		opts.index = index
 	}
+	if exclude != "" {
+		var excludeArr []string
+		for _, v := range strings.Split(exclude, ",") {
+			if v == "" {
+				continue
+			}
+			excludeArr = append(excludeArr, v)
+		}
+		opts.exclude = excludeArr
+	}
 	if fields != "" {
 		fieldArr := strings.Split(fields, ",")
 		var queryFields []string
@@ -151,11 +208,40 @@ func main() {
 }
 
 func (t *App) run() {
+	if t.opts.slices > 1 && t.opts.checkpointFile != "" {
+		log.Fatalf("-checkpoint is not supported together with -slices: each slice scrolls independently and progress isn't tracked per-slice")
+	}
+	if t.opts.slices > 1 && t.opts.pit {
+		log.Fatalf("-slices is not supported together with -pit: PITPaginator runs a single search_after stream, not a sliced scroll")
+	}
+	if t.opts.format == "parquet" && (t.opts.checkpointFile != "" || t.opts.resume) {
+		log.Fatalf("-checkpoint/-resume is not supported together with -format parquet: the parquet writer truncates -o on open, so resuming would silently discard every row written before the resume point")
+	}
+
 	t.getClient()
-	t.checkIndex()
+	t.resolveIndices()
 	t.buildQuery()
-	t.search()
-	t.clearScroll()
+	if t.opts.slices > 1 && t.queryHasAggs() {
+		log.Fatalf("-slices is not supported together with a query that has aggregations: each slice only sees its own partition of the data, so per-slice aggs can't be merged into one accurate result")
+	}
+	t.encoder = t.newEncoder()
+	defer t.encoder.Close()
+
+	if expected := t.countExpected(); expected > 0 {
+		t.progress = newProgress(expected)
+	}
+
+	t.checkpointAt = time.Now()
+	resumed := t.opts.resume && t.opts.checkpointFile != "" && t.resumeFromCheckpoint()
+	if !resumed {
+		t.paginator = t.newPaginator()
+		t.paginator.open(t)
+	}
+	t.paginator.close(t)
+
+	if t.opts.checkpointFile != "" {
+		os.Remove(t.opts.checkpointFile)
+	}
 	log.Println("All done")
 	log.Println("queryResult:", t.queryResult)
 	log.Println("numResult:", t.numResult)
@@ -197,31 +283,153 @@ func (t *App) getClient() *App {
 	return t
 }
 
-//checkIndex check if index(s) exists.
-func (t *App) checkIndex() {
+//resolveIndices expands any wildcards in opts.index (e.g. "logs-2024-*")
+//against the indices that actually exist, drops anything matching
+//-exclude, and fatals only if nothing is left to query.
+func (t *App) resolveIndices() {
 	if len(t.opts.index) == 0 {
 		log.Fatalf("Error index")
 	}
 
-	for _, name := range t.opts.index {
-		if name == "_all" {
-			t.opts.index = []string{name}
-			break
+	all := excludeMatching(t.catIndices(), t.opts.exclude)
+
+	var resolved []string
+	seen := map[string]struct{}{}
+	add := func(name string) {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			resolved = append(resolved, name)
 		}
 	}
 
-	res, err := t.esClient.Indices.Exists(t.opts.index)
+	for _, pattern := range t.opts.index {
+		if pattern == "_all" {
+			for _, name := range all {
+				add(name)
+			}
+			continue
+		}
+
+		for _, name := range matchAny(all, pattern) {
+			add(name)
+		}
+	}
+
+	if len(resolved) == 0 {
+		log.Fatalf("No index matched {%s} in {%s}.", strings.Join(t.opts.index, ","), strings.Join(t.opts.address, ","))
+	}
+
+	log.Printf("Matched %d index(es): %s", len(resolved), strings.Join(resolved, ","))
+	t.opts.index = resolved
+}
+
+//catIndices lists every index currently in the cluster.
+func (t *App) catIndices() []string {
+	res, err := t.esClient.Cat.Indices(
+		t.esClient.Cat.Indices.WithContext(context.Background()),
+		t.esClient.Cat.Indices.WithFormat("json"),
+	)
 	if err != nil {
-		log.Fatalf("Error getting response: %s", err)
+		log.Fatalf("Error listing indices: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Fatalf("Error listing indices: %s", res.String())
+	}
+
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		log.Fatalf("Error parsing the response body: %s", err)
+	}
+
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row.Index
 	}
+	return names
+}
 
-	if res.StatusCode != 200 {
-		log.Fatalf("Any of index(es) {%s} does not exist in {%s}.", strings.Join(t.opts.index, ","), strings.Join(t.opts.address, ","))
+//matchAny returns the names matching the glob pattern.
+func matchAny(names []string, pattern string) []string {
+	var out []string
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			out = append(out, name)
+		}
 	}
+	return out
+}
+
+//excludeMatching drops any name matching one of the glob patterns.
+func excludeMatching(names, patterns []string) []string {
+	if len(patterns) == 0 {
+		return names
+	}
+
+	var out []string
+	for _, name := range names {
+		excluded := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+//countExpected runs a pre-flight _count with the configured query so the
+//progress bar has an accurate total, since hits.total can be capped by
+//-m, or approximate ({"relation":"gte"}) on a large ES7+ index.
+func (t *App) countExpected() uint64 {
+	res, err := t.esClient.Count(
+		t.esClient.Count.WithContext(context.Background()),
+		t.esClient.Count.WithIndex(strings.Join(t.opts.index, ",")),
+		t.esClient.Count.WithQuery(t.opts.q),
+		t.esClient.Count.WithBody(t.countQueryBody()),
+	)
+	if err != nil {
+		log.Printf("Error getting expected count, progress will be unavailable: %s", err)
+		return 0
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Printf("Error getting expected count, progress will be unavailable: %s", res.String())
+		return 0
+	}
+
+	var c struct {
+		Count uint64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&c); err != nil {
+		log.Printf("Error parsing count response: %s", err)
+		return 0
+	}
+
+	if t.opts.maxResult > 0 && uint64(t.opts.maxResult) < c.Count {
+		return uint64(t.opts.maxResult)
+	}
+	return c.Count
 }
 
 //buildQuery format query flags to Query DSL.
 func (t *App) buildQuery() *App {
+	if t.opts.queryFile != "" {
+		cfg, err := query.LoadConfig(t.opts.queryFile)
+		if err != nil {
+			log.Fatalf("Error loading query file: %s", err)
+		}
+		t.opts.queryBody = cfg.Body(t.opts.size, t.opts.sort)
+		t.opts.q = ""
+		return t
+	}
+
 	//check if queryStr is valid
 	var buf bytes.Buffer
 	if t.opts.rawQuery && t.opts.q != "" {
@@ -240,20 +448,94 @@ func (t *App) buildQuery() *App {
 	return t
 }
 
+//countQueryBody extracts just the "query" clause from t.opts.queryBody for
+//use against _count, which unlike _search rejects unknown top-level keys
+//such as the "size" (and "sort", when set) that -query-file's body carries.
+func (t *App) countQueryBody() *bytes.Buffer {
+	var buf bytes.Buffer
+	if t.opts.queryBody == nil || t.opts.queryBody.Len() == 0 {
+		return &buf
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(t.opts.queryBody.Bytes(), &body); err != nil {
+		return &buf
+	}
+
+	q, ok := body["query"]
+	if !ok {
+		return &buf
+	}
+
+	_ = json.NewEncoder(&buf).Encode(map[string]interface{}{"query": q})
+	return &buf
+}
+
+//queryHasAggs reports whether t.opts.queryBody carries an "aggs" (or
+//"aggregations") section, e.g. from -query-file or -r. Used to reject -slices against an aggregation
+//query: each slice only aggregates over its own partition of the data, so
+//there's no single accurate result to merge the per-slice responses into.
+func (t *App) queryHasAggs() bool {
+	if t.opts.queryBody == nil || t.opts.queryBody.Len() == 0 {
+		return false
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(t.opts.queryBody.Bytes(), &body); err != nil {
+		return false
+	}
+
+	_, ok := body["aggs"]
+	if !ok {
+		_, ok = body["aggregations"]
+	}
+	return ok
+}
+
 //result is search result.
 type result struct {
-	ScrollID string  `json:"_scroll_id"`
-	Took     float64 `json:"took"`
-	Hits     hits    `json:"hits"`
+	ScrollID     string          `json:"_scroll_id"`
+	PitID        string          `json:"pit_id"`
+	Took         float64         `json:"took"`
+	Hits         hits            `json:"hits"`
+	Aggregations json.RawMessage `json:"aggregations"`
 }
 
 type hits struct {
-	Total uint64 `json:"total"`
-	Hits  []hit  `json:"hits"`
+	Total totalHits `json:"total"`
+	Hits  []hit     `json:"hits"`
+}
+
+//totalHits accepts both the pre-7.0 plain integer and the {"value",
+//"relation"} object ES7+ returns by default, where relation "gte" means
+//the count is a lower bound, not exact.
+type totalHits struct {
+	Value    uint64 `json:"value"`
+	Relation string `json:"relation"`
+}
+
+func (h *totalHits) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '{' {
+		return json.Unmarshal(data, &h.Value)
+	}
+	type alias totalHits
+	return json.Unmarshal(data, (*alias)(h))
 }
 
 type hit struct {
-	Source interface{} `json:"_source"`
+	ID     string        `json:"_id"`
+	Index  string        `json:"_index"`
+	Source interface{}   `json:"_source"`
+	Sort   []interface{} `json:"sort"`
+}
+
+//newPaginator picks the pagination strategy for the run. Scroll is the
+//default; -pit opts into the Point-in-Time + search_after alternative.
+func (t *App) newPaginator() Paginator {
+	if t.opts.pit {
+		return &PITPaginator{}
+	}
+	return &ScrollPaginator{}
 }
 
 //scroll do search scroll
@@ -279,7 +561,6 @@ func (t *App) search() {
 	res, err := t.esClient.Search(
 		t.esClient.Search.WithContext(context.Background()),
 		t.esClient.Search.WithIndex(strings.Join(t.opts.index, ",")),
-		t.esClient.Search.WithDocumentType(t.opts.docType),
 		t.esClient.Search.WithQuery(t.opts.q),
 		t.esClient.Search.WithBody(t.opts.queryBody),
 		t.esClient.Search.WithSource(strings.Join(t.opts.fields, ",")),
@@ -318,7 +599,11 @@ func (t *App) parseResult(response *esapi.Response) {
 		log.Fatalf("Error parsing the response body: %s", err)
 	}
 
-	t.queryResult = r.Hits.Total
+	if len(r.Aggregations) > 0 {
+		t.writeAggregations(r.Aggregations)
+	}
+
+	t.queryResult = r.Hits.Total.Value
 	//fix scroll with max result limit.
 	if t.opts.maxResult > 0 {
 		t.numResult = uint64(t.opts.maxResult)
@@ -328,9 +613,7 @@ func (t *App) parseResult(response *esapi.Response) {
 
 	if t.numResult > 0 && len(r.Hits.Hits) > 0 {
 		for totalLines != t.numResult {
-			if _, ok := t.sIDs[r.ScrollID]; !ok {
-				t.sIDs[r.ScrollID] = struct{}{}
-			}
+			t.addScrollID(r.ScrollID)
 
 			for _, v := range r.Hits.Hits {
 				totalLines++
@@ -349,7 +632,22 @@ func (t *App) parseResult(response *esapi.Response) {
 				}
 			}
 
-			t.scroll(r.ScrollID)
+			if t.progress != nil {
+				t.progress.update(totalLines)
+			}
+
+			if t.opts.checkpointFile != "" {
+				//Flush the trailing partial buffer first, so the checkpoint
+				//never advances past records that haven't actually reached
+				//disk yet (true whenever -s isn't a multiple of FLUSHBUFFER).
+				if len(hitResult) > 0 {
+					t.flushToFile(hitResult)
+					hitResult = []hit{}
+				}
+				t.saveCheckpoint(&r)
+			}
+
+			t.paginator.advance(t, &r)
 		}
 
 		if len(hitResult) > 0 {
@@ -359,25 +657,57 @@ func (t *App) parseResult(response *esapi.Response) {
 	}
 }
 
-//flushToFile flush the result to file
+//flushToFile flush the result to file, in whatever format -format selects.
 func (t *App) flushToFile(hits []hit) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	buf := t.pool.Get().(*bytes.Buffer)
-	buf.Reset()
-	defer t.pool.Put(buf)
+	t.encoder.Write(hits)
+}
 
-	for _, v := range hits {
-		j, _ := json.Marshal(v.Source)
+//writeAggregations writes the query's aggregations to -agg-output, once.
+func (t *App) writeAggregations(raw json.RawMessage) {
+	if t.aggsWritten || t.opts.aggOutputFile == "" {
+		return
+	}
 
-		buf.Write(j)
-		buf.WriteByte('\n')
+	fp, err := os.OpenFile(t.opts.aggOutputFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0777)
+	if err != nil {
+		log.Printf("Error opening aggregation output file: %s", err)
+		return
 	}
+	defer fp.Close()
+
+	fp.Write(raw)
+	fp.Write([]byte("\n"))
+	t.aggsWritten = true
+}
 
-	t.opts.output.Write(buf.Bytes())
+//addScrollID records a scroll id seen so far, guarded for concurrent slices.
+func (t *App) addScrollID(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sIDs[id] = struct{}{}
 }
 
-//clearScroll clears the search context for a scroll.
+//clearScroll clears the search context for every scroll id seen so far.
 func (t *App) clearScroll() {
-	t.esClient.ClearScroll.WithScrollID(strings.Join(t.scrollIDs, ","))
+	t.mutex.Lock()
+	ids := make([]string, 0, len(t.sIDs))
+	for id := range t.sIDs {
+		ids = append(ids, id)
+	}
+	t.mutex.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	res, err := t.esClient.ClearScroll(
+		t.esClient.ClearScroll.WithScrollID(strings.Join(ids, ",")),
+	)
+	if err != nil {
+		log.Printf("Error clearing scroll: %s", err)
+		return
+	}
+	defer res.Body.Close()
 }
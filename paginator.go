@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+)
+
+//Paginator abstracts how subsequent pages of a query are fetched. ScrollPaginator
+//is the default and matches the existing scroll-based behavior; PITPaginator
+//uses the ES8 Point-in-Time API with search_after instead.
+type Paginator interface {
+	//open issues the initial request for the query and starts decoding results.
+	open(t *App)
+	//advance issues the request for the page following r and decodes it.
+	advance(t *App, r *result)
+	//close releases any server-side pagination state held for the query.
+	close(t *App)
+}
+
+//ScrollPaginator paginates with a scroll context, same as before -pit existed.
+type ScrollPaginator struct{}
+
+func (p *ScrollPaginator) open(t *App) {
+	if t.opts.slices > 1 {
+		t.exportSlices()
+		return
+	}
+	t.search()
+}
+
+func (p *ScrollPaginator) advance(t *App, r *result) {
+	t.scroll(r.ScrollID)
+}
+
+func (p *ScrollPaginator) close(t *App) {
+	t.clearScroll()
+}
+
+//PITPaginator paginates with the ES8 Point-in-Time API and search_after,
+//avoiding the server-side scroll context altogether.
+type PITPaginator struct {
+	pitID string
+}
+
+func (p *PITPaginator) open(t *App) {
+	res, err := t.esClient.OpenPointInTime(
+		t.opts.index,
+		t.opts.scroll.String(),
+		t.esClient.OpenPointInTime.WithContext(context.Background()),
+	)
+	if err != nil {
+		log.Fatalf("Error opening point in time: %s", err)
+	}
+	defer res.Body.Close()
+
+	var o struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&o); err != nil {
+		log.Fatalf("Error parsing the response body: %s", err)
+	}
+	p.pitID = o.ID
+
+	sRes, err := t.esClient.Search(
+		t.esClient.Search.WithContext(context.Background()),
+		t.esClient.Search.WithBody(p.body(t, nil)),
+	)
+	if err != nil {
+		log.Fatalf("Error getting search response: %s", err)
+	}
+	defer sRes.Body.Close()
+
+	t.parseResult(sRes)
+}
+
+func (p *PITPaginator) advance(t *App, r *result) {
+	if r.PitID != "" {
+		p.pitID = r.PitID
+	}
+
+	var searchAfter []interface{}
+	if n := len(r.Hits.Hits); n > 0 {
+		searchAfter = r.Hits.Hits[n-1].Sort
+	}
+
+	res, err := t.esClient.Search(
+		t.esClient.Search.WithContext(context.Background()),
+		t.esClient.Search.WithBody(p.body(t, searchAfter)),
+	)
+	if err != nil {
+		log.Fatalf("Error getting search response: %s", err)
+	}
+	defer res.Body.Close()
+
+	t.parseResult(res)
+}
+
+func (p *PITPaginator) close(t *App) {
+	if p.pitID == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{"id": p.pitID})
+	if _, err := t.esClient.ClosePointInTime(
+		t.esClient.ClosePointInTime.WithContext(context.Background()),
+		t.esClient.ClosePointInTime.WithBody(bytes.NewReader(body)),
+	); err != nil {
+		log.Printf("Error closing point in time: %s", err)
+	}
+}
+
+//body builds the search body for a PIT request: the configured query and
+//sort plus the pit id and, once paging has started, search_after. The query
+//is merged in the same way sliceBody does it, so -query-file/-r's top-level
+//keys (e.g. "aggs" alongside "query") survive instead of being nested a
+//level too deep.
+func (p *PITPaginator) body(t *App, searchAfter []interface{}) *bytes.Buffer {
+	sort := []interface{}{"_shard_doc"}
+	if len(t.opts.sort) > 0 {
+		sort = make([]interface{}, len(t.opts.sort))
+		for i, v := range t.opts.sort {
+			sort[i] = v
+		}
+	}
+
+	body := map[string]interface{}{
+		"pit":     map[string]interface{}{"id": p.pitID, "keep_alive": t.opts.scroll.String()},
+		"size":    t.opts.size,
+		"sort":    sort,
+		"_source": t.opts.fields,
+	}
+
+	switch {
+	case t.opts.queryBody.Len() > 0:
+		var q map[string]interface{}
+		if err := json.Unmarshal(t.opts.queryBody.Bytes(), &q); err == nil {
+			for k, v := range q {
+				body[k] = v
+			}
+		}
+	case t.opts.q != "":
+		body["query"] = map[string]interface{}{"query_string": map[string]interface{}{"query": t.opts.q}}
+	default:
+		body["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+
+	if searchAfter != nil {
+		body["search_after"] = searchAfter
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		log.Fatalf("Error encoding query: %s", err)
+	}
+	return &buf
+}
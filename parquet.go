@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+//parquetEncoder writes hits as Parquet rows for downstream analytics
+//pipelines. Columns are the -f field list, each flattened to a dotted path
+//and written as a UTF8 string column; this keeps the schema derivable from
+//the CLI flags alone instead of requiring the caller to describe types for
+//every field in a document that may vary hit to hit.
+type parquetEncoder struct {
+	fw     source.ParquetFile
+	pw     *writer.JSONWriter
+	fields []string
+}
+
+func newParquetEncoder(path string, fields []string) *parquetEncoder {
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		log.Fatalf("Error creating parquet file: %s", err)
+	}
+
+	pw, err := writer.NewJSONWriter(parquetSchema(fields), fw, 4)
+	if err != nil {
+		log.Fatalf("Error creating parquet writer: %s", err)
+	}
+
+	return &parquetEncoder{fw: fw, pw: pw, fields: fields}
+}
+
+func (e *parquetEncoder) Write(hits []hit) {
+	for _, v := range hits {
+		flat := map[string]string{}
+		flattenJSON("", v.Source, flat)
+
+		row := make(map[string]string, len(e.fields))
+		for _, f := range e.fields {
+			row[strings.ReplaceAll(f, ".", "_")] = flat[f]
+		}
+
+		j, err := json.Marshal(row)
+		if err != nil {
+			log.Printf("Error marshaling parquet row: %s", err)
+			continue
+		}
+		if err := e.pw.Write(string(j)); err != nil {
+			log.Printf("Error writing parquet row: %s", err)
+		}
+	}
+}
+
+func (e *parquetEncoder) Close() {
+	if err := e.pw.WriteStop(); err != nil {
+		log.Printf("Error closing parquet writer: %s", err)
+	}
+	e.fw.Close()
+}
+
+//parquetSchema builds a JSON schema string describing one optional UTF8
+//string column per field, in the format parquet-go's JSON writer expects.
+func parquetSchema(fields []string) string {
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		name := strings.ReplaceAll(f, ".", "_")
+		cols[i] = fmt.Sprintf(`{"Tag": "name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"}`, name)
+	}
+
+	return fmt.Sprintf(`{"Tag": "name=mes_export, repetitiontype=REQUIRED", "Fields": [%s]}`, strings.Join(cols, ","))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+//progress prints a periodically-updated "done/total (pct) ETA" line to
+//stderr so a long export shows signs of life without spamming the logs.
+type progress struct {
+	total     uint64
+	started   time.Time
+	lastPrint time.Time
+}
+
+func newProgress(total uint64) *progress {
+	now := time.Now()
+	return &progress{total: total, started: now}
+}
+
+//update reports done out of total, throttled to at most twice a second.
+func (p *progress) update(done uint64) {
+	now := time.Now()
+	if now.Sub(p.lastPrint) < 500*time.Millisecond && done < p.total {
+		return
+	}
+	p.lastPrint = now
+
+	pct := float64(done) / float64(p.total) * 100
+	elapsed := now.Sub(p.started)
+
+	var eta time.Duration
+	if done > 0 && done < p.total {
+		eta = time.Duration(float64(elapsed) / float64(done) * float64(p.total-done))
+	}
+
+	fmt.Fprintf(os.Stderr, "\rExporting: %d/%d (%.1f%%) elapsed %s ETA %s  ",
+		done, p.total, pct, elapsed.Round(time.Second), eta.Round(time.Second))
+	if done >= p.total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,72 @@
+package query
+
+//Agg renders an aggregation clause, e.g. {"terms": {"field": "status"}}.
+type Agg interface {
+	Map() map[string]interface{}
+}
+
+//Aggs is a named set of aggregations, keyed by the name they're returned
+//under in the response's "aggregations" object.
+type Aggs map[string]Agg
+
+func (a Aggs) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for name, agg := range a {
+		out[name] = agg.Map()
+	}
+	return out
+}
+
+//TermsAgg buckets documents by the distinct values of field.
+type TermsAgg struct {
+	field string
+	size  int
+}
+
+func Terms(field string) *TermsAgg {
+	return &TermsAgg{field: field}
+}
+
+func (a *TermsAgg) Size(size int) *TermsAgg {
+	a.size = size
+	return a
+}
+
+func (a *TermsAgg) Map() map[string]interface{} {
+	body := map[string]interface{}{"field": a.field}
+	if a.size > 0 {
+		body["size"] = a.size
+	}
+	return map[string]interface{}{"terms": body}
+}
+
+//DateHistogramAgg buckets documents into date ranges of the given interval,
+//e.g. "day", "hour", "month".
+type DateHistogramAgg struct {
+	field    string
+	interval string
+}
+
+func DateHistogram(field, interval string) *DateHistogramAgg {
+	return &DateHistogramAgg{field: field, interval: interval}
+}
+
+func (a *DateHistogramAgg) Map() map[string]interface{} {
+	return map[string]interface{}{"date_histogram": map[string]interface{}{
+		"field":             a.field,
+		"calendar_interval": a.interval,
+	}}
+}
+
+//StatsAgg computes count/min/max/avg/sum for field.
+type StatsAgg struct {
+	field string
+}
+
+func Stats(field string) *StatsAgg {
+	return &StatsAgg{field: field}
+}
+
+func (a *StatsAgg) Map() map[string]interface{} {
+	return map[string]interface{}{"stats": map[string]interface{}{"field": a.field}}
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Config is a structured query loaded from a YAML or JSON file, as an
+//alternative to hand-writing Lucene (-q) or raw DSL (-r). Its Query and
+//Aggs sections mirror the Elasticsearch DSL shape directly, e.g.:
+//
+//	query:
+//	  bool:
+//	    must:
+//	      - term: {status: active}
+//	aggs:
+//	  by_status:
+//	    terms: {field: status}
+//
+//Query and Aggs are decoded into the typed clauses in query.go/agg.go,
+//which validates the shape up front instead of forwarding whatever the
+//file contains straight to Elasticsearch.
+type Config struct {
+	Query Mappable
+	Aggs  Aggs
+}
+
+//rawConfig is the shape LoadConfig unmarshals YAML/JSON into, before
+//decodeClause/decodeAggs turn it into typed clauses.
+type rawConfig struct {
+	Query map[string]interface{} `yaml:"query" json:"query"`
+	Aggs  map[string]interface{} `yaml:"aggs" json:"aggs"`
+}
+
+//LoadConfig reads a query Config from path, detecting YAML vs JSON by extension.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading query file: %w", err)
+	}
+
+	var raw rawConfig
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing query file: %w", err)
+	}
+
+	cfg := &Config{}
+	if len(raw.Query) > 0 {
+		cfg.Query, err = decodeClause(raw.Query)
+		if err != nil {
+			return nil, fmt.Errorf("decoding query: %w", err)
+		}
+	}
+	if len(raw.Aggs) > 0 {
+		cfg.Aggs, err = decodeAggs(raw.Aggs)
+		if err != nil {
+			return nil, fmt.Errorf("decoding aggs: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+//Body renders the Config into the search request body, applying size and
+//sort the same way the rest of the app's flags do.
+func (c *Config) Body(size int, sort []string) *bytes.Buffer {
+	body := map[string]interface{}{}
+	if c.Query != nil {
+		body["query"] = c.Query.Map()
+	}
+	if len(c.Aggs) > 0 {
+		body["aggs"] = c.Aggs.Map()
+	}
+	if size > 0 {
+		body["size"] = size
+	}
+	if len(sort) > 0 {
+		body["sort"] = sort
+	}
+
+	var buf bytes.Buffer
+	//errors here would mean body contains something that can't be
+	//marshaled. The clause shapes are checked when decoded, but leaf values
+	//are kept as the file decoded them (e.g. a YAML map with non-string
+	//keys), and on such an error the returned buffer is empty.
+	_ = json.NewEncoder(&buf).Encode(body)
+	return &buf
+}
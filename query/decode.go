@@ -0,0 +1,238 @@
+package query
+
+import "fmt"
+
+//decodeClause converts one decoded YAML/JSON query clause (e.g.
+//{"term": {"status": "active"}}) into its typed Mappable, validating the
+//shape along the way instead of passing the raw map straight to Elasticsearch.
+func decodeClause(m map[string]interface{}) (Mappable, error) {
+	if len(m) != 1 {
+		return nil, fmt.Errorf("query clause must have exactly one key, got %d", len(m))
+	}
+
+	for k, v := range m {
+		switch k {
+		case "bool":
+			return decodeBool(v)
+		case "term":
+			return decodeFieldValue(v, "term", func(field string, value interface{}) Mappable {
+				return Term(field, value)
+			})
+		case "match":
+			return decodeFieldValue(v, "match", func(field string, value interface{}) Mappable {
+				return Match(field, value)
+			})
+		case "range":
+			return decodeRange(v)
+		case "wildcard":
+			return decodeWildcard(v)
+		case "exists":
+			return decodeExists(v)
+		case "nested":
+			return decodeNested(v)
+		default:
+			return nil, fmt.Errorf("unknown query clause %q", k)
+		}
+	}
+	panic("unreachable")
+}
+
+//decodeFieldValue handles the common {"field": value} shape shared by term
+//and match clauses.
+func decodeFieldValue(v interface{}, name string, build func(field string, value interface{}) Mappable) (Mappable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("%s: expected a single field:value object", name)
+	}
+	for field, value := range m {
+		return build(field, value), nil
+	}
+	panic("unreachable")
+}
+
+func decodeWildcard(v interface{}) (Mappable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("wildcard: expected a single field:pattern object")
+	}
+	for field, pattern := range m {
+		p, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("wildcard: pattern for %q must be a string", field)
+		}
+		return Wildcard(field, p), nil
+	}
+	panic("unreachable")
+}
+
+func decodeExists(v interface{}) (Mappable, error) {
+	field, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("exists: expected a field name string")
+	}
+	return Exists(field), nil
+}
+
+func decodeRange(v interface{}) (Mappable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("range: expected a single field:{gte,lte,gt,lt} object")
+	}
+	for field, bounds := range m {
+		b, ok := bounds.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("range: bounds for %q must be an object", field)
+		}
+
+		r := Range(field)
+		for op, val := range b {
+			switch op {
+			case "gte":
+				r.Gte(val)
+			case "lte":
+				r.Lte(val)
+			case "gt":
+				r.Gt(val)
+			case "lt":
+				r.Lt(val)
+			default:
+				return nil, fmt.Errorf("range: unknown bound %q", op)
+			}
+		}
+		return r, nil
+	}
+	panic("unreachable")
+}
+
+func decodeBool(v interface{}) (Mappable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bool: expected an object")
+	}
+
+	b := Bool()
+	occurrences := map[string]func(...Mappable) *BoolQuery{
+		"must":     b.Must,
+		"should":   b.Should,
+		"must_not": b.MustNot,
+		"filter":   b.Filter,
+	}
+	for key, add := range occurrences {
+		raw, ok := m[key]
+		if !ok {
+			continue
+		}
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("bool.%s: expected a list of query clauses", key)
+		}
+		for _, item := range list {
+			im, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("bool.%s: expected a list of query clauses", key)
+			}
+			clause, err := decodeClause(im)
+			if err != nil {
+				return nil, fmt.Errorf("bool.%s: %w", key, err)
+			}
+			add(clause)
+		}
+	}
+	return b, nil
+}
+
+func decodeNested(v interface{}) (Mappable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nested: expected an object")
+	}
+
+	path, ok := m["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("nested: missing path")
+	}
+	qm, ok := m["query"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nested: missing query")
+	}
+
+	q, err := decodeClause(qm)
+	if err != nil {
+		return nil, fmt.Errorf("nested.query: %w", err)
+	}
+	return Nested(path, q), nil
+}
+
+//decodeAggs converts the decoded "aggs" section into a typed Aggs set.
+func decodeAggs(m map[string]interface{}) (Aggs, error) {
+	out := make(Aggs, len(m))
+	for name, v := range m {
+		spec, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("agg %q: expected an object", name)
+		}
+		agg, err := decodeAgg(spec)
+		if err != nil {
+			return nil, fmt.Errorf("agg %q: %w", name, err)
+		}
+		out[name] = agg
+	}
+	return out, nil
+}
+
+func decodeAgg(m map[string]interface{}) (Agg, error) {
+	if len(m) != 1 {
+		return nil, fmt.Errorf("must have exactly one key, got %d", len(m))
+	}
+
+	for k, v := range m {
+		body, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%q: expected an object", k)
+		}
+
+		switch k {
+		case "terms":
+			field, _ := body["field"].(string)
+			if field == "" {
+				return nil, fmt.Errorf("terms: missing field")
+			}
+			a := Terms(field)
+			if size, ok := toInt(body["size"]); ok {
+				a.Size(size)
+			}
+			return a, nil
+		case "date_histogram":
+			field, _ := body["field"].(string)
+			interval, _ := body["calendar_interval"].(string)
+			if field == "" || interval == "" {
+				return nil, fmt.Errorf("date_histogram: field and calendar_interval are required")
+			}
+			return DateHistogram(field, interval), nil
+		case "stats":
+			field, _ := body["field"].(string)
+			if field == "" {
+				return nil, fmt.Errorf("stats: missing field")
+			}
+			return Stats(field), nil
+		default:
+			return nil, fmt.Errorf("unknown aggregation %q", k)
+		}
+	}
+	panic("unreachable")
+}
+
+//toInt accepts the numeric shapes a YAML or JSON decoder may produce for an
+//interface{} value.
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
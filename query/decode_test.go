@@ -0,0 +1,200 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeClause(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "term",
+			in:   map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+			want: map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+		},
+		{
+			name: "match",
+			in:   map[string]interface{}{"match": map[string]interface{}{"title": "foo"}},
+			want: map[string]interface{}{"match": map[string]interface{}{"title": "foo"}},
+		},
+		{
+			name: "range",
+			in:   map[string]interface{}{"range": map[string]interface{}{"age": map[string]interface{}{"gte": 18, "lt": 65}}},
+			want: map[string]interface{}{"range": map[string]interface{}{"age": map[string]interface{}{"gte": 18, "lt": 65}}},
+		},
+		{
+			name: "wildcard",
+			in:   map[string]interface{}{"wildcard": map[string]interface{}{"name": "a*"}},
+			want: map[string]interface{}{"wildcard": map[string]interface{}{"name": "a*"}},
+		},
+		{
+			name: "exists",
+			in:   map[string]interface{}{"exists": "email"},
+			want: map[string]interface{}{"exists": map[string]interface{}{"field": "email"}},
+		},
+		{
+			name: "nested",
+			in: map[string]interface{}{"nested": map[string]interface{}{
+				"path":  "comments",
+				"query": map[string]interface{}{"term": map[string]interface{}{"comments.author": "bob"}},
+			}},
+			want: map[string]interface{}{"nested": map[string]interface{}{
+				"path":  "comments",
+				"query": map[string]interface{}{"term": map[string]interface{}{"comments.author": "bob"}},
+			}},
+		},
+		{
+			name: "bool with must",
+			in: map[string]interface{}{"bool": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+				},
+			}},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"must": []map[string]interface{}{
+					{"term": map[string]interface{}{"status": "active"}},
+				},
+			}},
+		},
+		{
+			name:    "more than one key is rejected",
+			in:      map[string]interface{}{"term": map[string]interface{}{"a": 1}, "match": map[string]interface{}{"b": 2}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown clause is rejected",
+			in:      map[string]interface{}{"fuzzy": map[string]interface{}{"a": 1}},
+			wantErr: true,
+		},
+		{
+			name:    "range with an unknown bound is rejected",
+			in:      map[string]interface{}{"range": map[string]interface{}{"age": map[string]interface{}{"bogus": 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard with a non-string pattern is rejected",
+			in:      map[string]interface{}{"wildcard": map[string]interface{}{"name": 1}},
+			wantErr: true,
+		},
+		{
+			name:    "nested without a path is rejected",
+			in:      map[string]interface{}{"nested": map[string]interface{}{"query": map[string]interface{}{"term": map[string]interface{}{"a": 1}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeClause(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeClause(%v): expected an error, got none", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeClause(%v): unexpected error: %s", tt.in, err)
+			}
+			if !reflect.DeepEqual(got.Map(), tt.want) {
+				t.Fatalf("decodeClause(%v) = %#v, want %#v", tt.in, got.Map(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAggs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "terms with size",
+			in:   map[string]interface{}{"by_status": map[string]interface{}{"terms": map[string]interface{}{"field": "status", "size": 5}}},
+			want: map[string]interface{}{"by_status": map[string]interface{}{"terms": map[string]interface{}{"field": "status", "size": 5}}},
+		},
+		{
+			name: "terms without size",
+			in:   map[string]interface{}{"by_status": map[string]interface{}{"terms": map[string]interface{}{"field": "status"}}},
+			want: map[string]interface{}{"by_status": map[string]interface{}{"terms": map[string]interface{}{"field": "status"}}},
+		},
+		{
+			name: "date_histogram",
+			in:   map[string]interface{}{"by_day": map[string]interface{}{"date_histogram": map[string]interface{}{"field": "created_at", "calendar_interval": "day"}}},
+			want: map[string]interface{}{"by_day": map[string]interface{}{"date_histogram": map[string]interface{}{"field": "created_at", "calendar_interval": "day"}}},
+		},
+		{
+			name: "stats",
+			in:   map[string]interface{}{"price_stats": map[string]interface{}{"stats": map[string]interface{}{"field": "price"}}},
+			want: map[string]interface{}{"price_stats": map[string]interface{}{"stats": map[string]interface{}{"field": "price"}}},
+		},
+		{
+			name:    "terms missing field is rejected",
+			in:      map[string]interface{}{"by_status": map[string]interface{}{"terms": map[string]interface{}{}}},
+			wantErr: true,
+		},
+		{
+			name:    "date_histogram missing calendar_interval is rejected",
+			in:      map[string]interface{}{"by_day": map[string]interface{}{"date_histogram": map[string]interface{}{"field": "created_at"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown aggregation is rejected",
+			in:      map[string]interface{}{"whatever": map[string]interface{}{"cardinality": map[string]interface{}{"field": "id"}}},
+			wantErr: true,
+		},
+		{
+			name:    "more than one key under an agg name is rejected",
+			in:      map[string]interface{}{"whatever": map[string]interface{}{"terms": map[string]interface{}{"field": "status"}, "stats": map[string]interface{}{"field": "price"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAggs(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeAggs(%v): expected an error, got none", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeAggs(%v): unexpected error: %s", tt.in, err)
+			}
+			if !reflect.DeepEqual(got.Map(), tt.want) {
+				t.Fatalf("decodeAggs(%v) = %#v, want %#v", tt.in, got.Map(), tt.want)
+			}
+		})
+	}
+}
+
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want int
+		ok   bool
+	}{
+		{"int", 5, 5, true},
+		{"int64", int64(5), 5, true},
+		{"float64 from JSON/YAML", float64(5), 5, true},
+		{"string is not a number", "5", 0, false},
+		{"nil is not a number", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := toInt(tt.in)
+			if ok != tt.ok || got != tt.want {
+				t.Fatalf("toInt(%v) = (%d, %v), want (%d, %v)", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+//Package query is a small, typed Query DSL builder for Elasticsearch,
+//inspired by aquasecurity/esquery. It lets callers compose bool/term/range/
+//match/wildcard/exists/nested clauses in Go instead of hand-writing JSON.
+package query
+
+//Mappable renders a query clause as the map structure Elasticsearch expects,
+//e.g. {"term": {"field": "value"}}.
+type Mappable interface {
+	Map() map[string]interface{}
+}
+
+//BoolQuery composes other clauses with must/should/must_not/filter.
+type BoolQuery struct {
+	must    []Mappable
+	should  []Mappable
+	mustNot []Mappable
+	filter  []Mappable
+}
+
+//Bool starts an empty bool query.
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+func (q *BoolQuery) Must(clauses ...Mappable) *BoolQuery {
+	q.must = append(q.must, clauses...)
+	return q
+}
+
+func (q *BoolQuery) Should(clauses ...Mappable) *BoolQuery {
+	q.should = append(q.should, clauses...)
+	return q
+}
+
+func (q *BoolQuery) MustNot(clauses ...Mappable) *BoolQuery {
+	q.mustNot = append(q.mustNot, clauses...)
+	return q
+}
+
+func (q *BoolQuery) Filter(clauses ...Mappable) *BoolQuery {
+	q.filter = append(q.filter, clauses...)
+	return q
+}
+
+func (q *BoolQuery) Map() map[string]interface{} {
+	inner := map[string]interface{}{}
+	if len(q.must) > 0 {
+		inner["must"] = mapAll(q.must)
+	}
+	if len(q.should) > 0 {
+		inner["should"] = mapAll(q.should)
+	}
+	if len(q.mustNot) > 0 {
+		inner["must_not"] = mapAll(q.mustNot)
+	}
+	if len(q.filter) > 0 {
+		inner["filter"] = mapAll(q.filter)
+	}
+	return map[string]interface{}{"bool": inner}
+}
+
+//TermQuery matches documents where field is exactly value.
+type TermQuery struct {
+	field string
+	value interface{}
+}
+
+func Term(field string, value interface{}) *TermQuery {
+	return &TermQuery{field: field, value: value}
+}
+
+func (q *TermQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{q.field: q.value}}
+}
+
+//RangeQuery matches documents where field falls within the configured bounds.
+type RangeQuery struct {
+	field   string
+	clauses map[string]interface{}
+}
+
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, clauses: map[string]interface{}{}}
+}
+
+func (q *RangeQuery) Gte(value interface{}) *RangeQuery {
+	q.clauses["gte"] = value
+	return q
+}
+
+func (q *RangeQuery) Lte(value interface{}) *RangeQuery {
+	q.clauses["lte"] = value
+	return q
+}
+
+func (q *RangeQuery) Gt(value interface{}) *RangeQuery {
+	q.clauses["gt"] = value
+	return q
+}
+
+func (q *RangeQuery) Lt(value interface{}) *RangeQuery {
+	q.clauses["lt"] = value
+	return q
+}
+
+func (q *RangeQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"range": map[string]interface{}{q.field: q.clauses}}
+}
+
+//MatchQuery runs a full text match on field.
+type MatchQuery struct {
+	field string
+	value interface{}
+}
+
+func Match(field string, value interface{}) *MatchQuery {
+	return &MatchQuery{field: field, value: value}
+}
+
+func (q *MatchQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"match": map[string]interface{}{q.field: q.value}}
+}
+
+//WildcardQuery matches field against a pattern containing * and ?.
+type WildcardQuery struct {
+	field   string
+	pattern string
+}
+
+func Wildcard(field, pattern string) *WildcardQuery {
+	return &WildcardQuery{field: field, pattern: pattern}
+}
+
+func (q *WildcardQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"wildcard": map[string]interface{}{q.field: q.pattern}}
+}
+
+//ExistsQuery matches documents that have a non-null value for field.
+type ExistsQuery struct {
+	field string
+}
+
+func Exists(field string) *ExistsQuery {
+	return &ExistsQuery{field: field}
+}
+
+func (q *ExistsQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"exists": map[string]interface{}{"field": q.field}}
+}
+
+//NestedQuery runs query against objects stored under the nested path.
+type NestedQuery struct {
+	path  string
+	query Mappable
+}
+
+func Nested(path string, query Mappable) *NestedQuery {
+	return &NestedQuery{path: path, query: query}
+}
+
+func (q *NestedQuery) Map() map[string]interface{} {
+	return map[string]interface{}{"nested": map[string]interface{}{
+		"path":  q.path,
+		"query": q.query.Map(),
+	}}
+}
+
+func mapAll(clauses []Mappable) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(clauses))
+	for i, c := range clauses {
+		out[i] = c.Map()
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//reportProgress advances the shared line count by delta and redraws the
+//progress line, guarded by t.mutex since -slices drives this from multiple
+//goroutines at once.
+func (t *App) reportProgress(delta uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.totalLines += delta
+	if t.progress != nil {
+		t.progress.update(t.totalLines)
+	}
+}
+
+//exportSlices runs -slices parallel scroll exports, one per ES slice, and
+//merges their hits into the shared output via flushToFile's mutex. Each
+//slice scrolls independently with its own scroll id and its own running
+//count; maxResult is divided across slices up front rather than trimmed
+//after the fact.
+func (t *App) exportSlices() {
+	quotas := sliceQuotas(t.opts.maxResult, t.opts.slices)
+
+	var wg sync.WaitGroup
+	for i := 0; i < t.opts.slices; i++ {
+		wg.Add(1)
+		go func(id, quota int) {
+			defer wg.Done()
+			t.runSlice(id, quota)
+		}(i, quotas[i])
+	}
+	wg.Wait()
+
+	t.numResult = t.totalLines
+}
+
+//sliceQuotas divides maxResult evenly across slices, handing the remainder
+//to the first slices so the quotas sum to exactly maxResult. A maxResult of
+//0 means no limit, so every slice gets a quota of 0 (unlimited).
+func sliceQuotas(maxResult, slices int) []int {
+	quotas := make([]int, slices)
+	if maxResult <= 0 {
+		return quotas
+	}
+
+	per := maxResult / slices
+	rem := maxResult % slices
+	for i := range quotas {
+		quotas[i] = per
+		if i < rem {
+			quotas[i]++
+		}
+	}
+	return quotas
+}
+
+//runSlice exports a single ES slice to completion, stopping at quota hits
+//if quota > 0.
+func (t *App) runSlice(id, quota int) {
+	res, err := t.esClient.Search(
+		t.esClient.Search.WithContext(context.Background()),
+		t.esClient.Search.WithIndex(strings.Join(t.opts.index, ",")),
+		t.esClient.Search.WithBody(t.sliceBody(id)),
+		t.esClient.Search.WithSource(strings.Join(t.opts.fields, ",")),
+		t.esClient.Search.WithSize(t.opts.size),
+		t.esClient.Search.WithSort(strings.Join(t.opts.sort, ",")),
+		t.esClient.Search.WithScroll(t.opts.scroll),
+	)
+	if err != nil {
+		log.Fatalf("Error getting search response for slice %d: %s", id, err)
+	}
+
+	var r result
+	decodeErr := json.NewDecoder(res.Body).Decode(&r)
+	res.Body.Close()
+	if decodeErr != nil {
+		log.Fatalf("Error parsing the response body: %s", decodeErr)
+	}
+
+	//Aggregations aren't handled here: run() fatals before exportSlices is
+	//ever reached if the query has aggs, since each slice only aggregates
+	//over its own partition of the data and the per-slice results can't be
+	//merged into one accurate answer.
+
+	limit := r.Hits.Total.Value
+	if quota > 0 && uint64(quota) < limit {
+		limit = uint64(quota)
+	}
+
+	var lines uint64
+	var buf []hit
+	scrollID, page := r.ScrollID, r.Hits.Hits
+
+	for limit > 0 && len(page) > 0 {
+		t.addScrollID(scrollID)
+
+		for _, v := range page {
+			lines++
+			buf = append(buf, v)
+
+			if len(buf) == FLUSHBUFFER {
+				t.flushToFile(buf)
+				t.reportProgress(uint64(len(buf)))
+				buf = nil
+			}
+			if lines == limit {
+				break
+			}
+		}
+		if lines == limit {
+			break
+		}
+
+		sres, err := t.esClient.Scroll(
+			t.esClient.Scroll.WithContext(context.Background()),
+			t.esClient.Scroll.WithScrollID(scrollID),
+			t.esClient.Scroll.WithScroll(t.opts.scroll),
+		)
+		if err != nil {
+			log.Fatalf("Error getting scroll response for slice %d: %s", id, err)
+		}
+
+		var sr result
+		decodeErr := json.NewDecoder(sres.Body).Decode(&sr)
+		sres.Body.Close()
+		if decodeErr != nil {
+			log.Fatalf("Error parsing the response body: %s", decodeErr)
+		}
+		scrollID, page = sr.ScrollID, sr.Hits.Hits
+	}
+
+	if len(buf) > 0 {
+		t.flushToFile(buf)
+		t.reportProgress(uint64(len(buf)))
+	}
+
+	atomic.AddUint64(&t.queryResult, r.Hits.Total.Value)
+}
+
+//sliceBody adds the slice/max clause for slice id to the configured query.
+func (t *App) sliceBody(id int) *bytes.Buffer {
+	body := map[string]interface{}{
+		"slice": map[string]interface{}{"id": id, "max": t.opts.slices},
+	}
+
+	switch {
+	case t.opts.queryBody.Len() > 0:
+		var q map[string]interface{}
+		if err := json.Unmarshal(t.opts.queryBody.Bytes(), &q); err == nil {
+			for k, v := range q {
+				body[k] = v
+			}
+		}
+	case t.opts.q != "":
+		body["query"] = map[string]interface{}{"query_string": map[string]interface{}{"query": t.opts.q}}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		log.Fatalf("Error encoding query: %s", err)
+	}
+	return &buf
+}
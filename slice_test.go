@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSliceQuotas(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxResult int
+		slices    int
+		want      []int
+	}{
+		{"no limit divides nothing", 0, 4, []int{0, 0, 0, 0}},
+		{"evenly divisible", 100, 4, []int{25, 25, 25, 25}},
+		{"remainder goes to the first slices", 10, 3, []int{4, 3, 3}},
+		{"single slice gets the whole limit", 10, 1, []int{10}},
+		{"negative maxResult is treated as no limit", -1, 2, []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sliceQuotas(tt.maxResult, tt.slices)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("sliceQuotas(%d, %d) = %v, want %v", tt.maxResult, tt.slices, got, tt.want)
+			}
+
+			sum := 0
+			for _, q := range got {
+				sum += q
+			}
+			if tt.maxResult > 0 && sum != tt.maxResult {
+				t.Fatalf("sliceQuotas(%d, %d) sums to %d, want %d", tt.maxResult, tt.slices, sum, tt.maxResult)
+			}
+		})
+	}
+}